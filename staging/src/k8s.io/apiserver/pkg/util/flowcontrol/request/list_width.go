@@ -20,8 +20,11 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	apirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/features"
@@ -29,15 +32,45 @@ import (
 	"k8s.io/klog/v2"
 )
 
-func newListWidthEstimator(countFn objectCountGetterFunc) WidthEstimatorFunc {
+// IndexCostEstimator lets a storage layer that maintains secondary
+// indexes (e.g. the watchcache's field/label indexers) report a
+// cheaper, selector-aware object count for a list request that can be
+// served from one of its indexes, instead of the unfiltered object
+// count for the whole resource.
+type IndexCostEstimator interface {
+	// EstimateMatchingObjects returns the estimated number of objects
+	// that selector and labelSelector would match if evaluated against
+	// an index. indexed is false when no index applies, in which case
+	// count must be ignored by the caller.
+	EstimateMatchingObjects(selector fields.Selector, labelSelector labels.Selector) (count int64, indexed bool)
+}
+
+const (
+	// listAdditionalLatencyThreshold is the number of objects above which
+	// a list request is expected to start incurring additional latency
+	// that isn't already reflected by the seats allocated to it.
+	listAdditionalLatencyThreshold = 1000
+
+	// listAdditionalLatencyPerObject is the additional latency charged
+	// for every object beyond listAdditionalLatencyThreshold.
+	listAdditionalLatencyPerObject = 100 * time.Microsecond
+)
+
+func newListWidthEstimator(countFn objectCountGetterFunc, indexCostEstimators map[schema.GroupResource]IndexCostEstimator) WidthEstimatorFunc {
 	estimator := &listWidthEstimator{
-		countFn: countFn,
+		countFn:             countFn,
+		indexCostEstimators: indexCostEstimators,
 	}
 	return estimator.estimate
 }
 
 type listWidthEstimator struct {
 	countFn objectCountGetterFunc
+
+	// indexCostEstimators, keyed by GroupResource, let a resource backed
+	// by an index at the watchcache level report a selector-aware object
+	// count instead of the unfiltered count from countFn.
+	indexCostEstimators map[schema.GroupResource]IndexCostEstimator
 }
 
 func (e *listWidthEstimator) estimate(r *http.Request) Width {
@@ -55,23 +88,45 @@ func (e *listWidthEstimator) estimate(r *http.Request) Width {
 		return Width{Seats: minimumSeats}
 	}
 
-	count := e.countFn.Get(key(requestInfo))
+	gr := groupResource(requestInfo)
+	count := e.countFn.Get(gr.String())
 	isListFromCache := !shouldListFromStorage(query, &listOptions)
 
-	if (listOptions.Limit == 0 || isListFromCache) && count == 0 {
+	// If the cached path is backed by an index that can answer the
+	// request's selectors directly, prefer its (cheaper, filtered)
+	// count over the unfiltered count from countFn.
+	indexed := false
+	if isListFromCache {
+		if indexEstimator, ok := e.indexCostEstimators[gr]; ok {
+			fieldSelector, fieldErr := fields.ParseSelector(listOptions.FieldSelector)
+			labelSelector, labelErr := labels.Parse(listOptions.LabelSelector)
+			if fieldErr == nil && labelErr == nil {
+				if indexedCount, ok := indexEstimator.EstimateMatchingObjects(fieldSelector, labelSelector); ok {
+					count = indexedCount
+					indexed = true
+				}
+			}
+		}
+	}
+
+	if (listOptions.Limit == 0 || isListFromCache) && count == 0 && !indexed {
 		// if object count is not known then we allocate maximum seats when:
 		// - limit is zero, or
 		// - we are listing from cache
 		return Width{Seats: maximumSeats}
 	}
 
-	// TODO: For resources that implement indexes at the watchcache level,
-	//  we need to adjust the cost accordingly
 	var estimatedObjectsToBeProcessed int64
 	switch {
 	case isListFromCache:
-		// if we are here, count is known
+		// if we are here, count is known (either from countFn, or,
+		// when indexed is true, from the index itself)
 		estimatedObjectsToBeProcessed = count
+		if listOptions.Limit > 0 && listOptions.Limit < estimatedObjectsToBeProcessed {
+			// honor the limit on the cached path the same way the etcd
+			// path already does below
+			estimatedObjectsToBeProcessed = listOptions.Limit
+		}
 	default:
 		// Even if a selector is specified and we may need to list and go over more objects from etcd
 		// to produce the result of size <limit>, each individual chunk will be of size at most <limit>.
@@ -97,19 +152,25 @@ func (e *listWidthEstimator) estimate(r *http.Request) Width {
 	if seats > maximumSeats {
 		seats = maximumSeats
 	}
-	return Width{Seats: seats}
+
+	var additionalLatency time.Duration
+	if estimatedObjectsToBeProcessed > listAdditionalLatencyThreshold {
+		additionalLatency = time.Duration(estimatedObjectsToBeProcessed-listAdditionalLatencyThreshold) * listAdditionalLatencyPerObject
+	}
+
+	return Width{Seats: seats, AdditionalLatency: additionalLatency}
 }
 
-func key(requestInfo *apirequest.RequestInfo) string {
-	groupResource := &schema.GroupResource{
+func groupResource(requestInfo *apirequest.RequestInfo) schema.GroupResource {
+	return schema.GroupResource{
 		Group:    requestInfo.APIGroup,
 		Resource: requestInfo.Resource,
 	}
-	return groupResource.String()
 }
 
 // NOTICE: Keep in sync with shouldDelegateList function in
-//  staging/src/k8s.io/apiserver/pkg/storage/cacher/cacher.go
+//
+//	staging/src/k8s.io/apiserver/pkg/storage/cacher/cacher.go
 func shouldListFromStorage(query url.Values, opts *metav1.ListOptions) bool {
 	resourceVersion := opts.ResourceVersion
 	pagingEnabled := utilfeature.DefaultFeatureGate.Enabled(features.APIListChunking)
@@ -0,0 +1,35 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package request
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var widthEstimationRatio = metrics.NewGaugeVec(
+	&metrics.GaugeOpts{
+		Name:           "apiserver_flowcontrol_width_estimation_ratio",
+		Help:           "The EWMA of the ratio between actual and estimated width for requests, labeled by group, resource and verb",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"group", "resource", "verb"},
+)
+
+func init() {
+	legacyregistry.MustRegister(widthEstimationRatio)
+}
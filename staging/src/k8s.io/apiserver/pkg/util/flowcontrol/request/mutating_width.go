@@ -19,19 +19,52 @@ package request
 import (
 	"math"
 	"net/http"
+	"time"
 
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	apirequest "k8s.io/apiserver/pkg/endpoints/request"
 )
 
-func newMutatingWidthEstimator(countFn watchCountGetterFunc) WidthEstimatorFunc {
+const (
+	// mutatingAdditionalLatencyThreshold is the number of registered
+	// watchers above which a mutating request is expected to start
+	// incurring additional latency fanning out the resulting event that
+	// isn't already reflected by the seats allocated to it.
+	mutatingAdditionalLatencyThreshold = 1000
+
+	// fanoutRate is the rate, in watchers per second, at which a single
+	// apiserver instance is expected to be able to fan out one event to
+	// registered watchers.
+	fanoutRate = 5000
+
+	// budgetBytesPerSeat is the amount of fan-out work, in watchers times
+	// average serialized object bytes, that a single seat is expected to
+	// cover. It is sized so that, for the ~1KiB average object assumed
+	// when objectSizeGetterFunc is unavailable, the resulting formula
+	// matches the legacy watch-count-only one (e.g. 299 watchers -> 3
+	// seats).
+	budgetBytesPerSeat = 100 * 1024
+
+	// defaultAverageObjectBytes is assumed when objectSizeGetterFunc is
+	// given but reports no data yet for a GroupResource.
+	defaultAverageObjectBytes = 1024
+)
+
+func newMutatingWidthEstimator(countFn watchCountGetterFunc, sizeFn objectSizeGetterFunc) WidthEstimatorFunc {
 	estimator := &mutatingWidthEstimator{
 		countFn: countFn,
+		sizeFn:  sizeFn,
 	}
 	return estimator.estimate
 }
 
 type mutatingWidthEstimator struct {
 	countFn watchCountGetterFunc
+
+	// sizeFn, when set, reports the rolling average serialized size of
+	// objects for a GroupResource so the seat cost can scale with the
+	// actual fan-out payload rather than assuming a fixed object size.
+	sizeFn objectSizeGetterFunc
 }
 
 func (e *mutatingWidthEstimator) estimate(r *http.Request) Width {
@@ -42,20 +75,57 @@ func (e *mutatingWidthEstimator) estimate(r *http.Request) Width {
 
 	watchCount := e.countFn.Get(requestInfo)
 
-	// for now, our rough estimate is to allocate one seat for each each 100 watchers
-	// potentially interested in a given object.
-	//
-	// TODO: As described in the KEP it should be much more sophisticated, including:
-	// - taking advantage of `additional latency` concept once this is implemented
-	// - taking into account cost of a single event (different events may have
-	//   different size).
-	// However, we start simple first to get some operational experience from it.
-	seats := uint(math.Ceil(float64(watchCount) / float64(100)))
+	var seats uint
+	if avgObjectBytes := e.averageObjectBytes(requestInfo); avgObjectBytes > 0 {
+		// scale the seat cost with how much data actually has to be fanned
+		// out to the registered watchers, rather than charging the same
+		// one-seat-per-100-watchers regardless of object size.
+		seats = uint(math.Ceil(float64(watchCount) * float64(avgObjectBytes) / float64(budgetBytesPerSeat)))
+	} else {
+		// for now, our rough estimate is to allocate one seat for each each 100 watchers
+		// potentially interested in a given object.
+		seats = uint(math.Ceil(float64(watchCount) / float64(100)))
+	}
 	if seats < minimumSeats {
 		seats = minimumSeats
 	}
 	if seats > maximumSeats {
 		seats = maximumSeats
 	}
-	return Width{Seats: seats}
+
+	// Beyond a certain fan-out size, delivering the resulting watch event to
+	// every watcher takes noticeably longer than the service time already
+	// reflected by the seats above; charge that as additional latency
+	// instead of inflating seats further.
+	var additionalLatency time.Duration
+	if watchCount > mutatingAdditionalLatencyThreshold {
+		additionalLatency = time.Duration(float64(watchCount-mutatingAdditionalLatencyThreshold) / fanoutRate * float64(time.Second))
+	}
+
+	return Width{Seats: seats, AdditionalLatency: additionalLatency}
+}
+
+// averageObjectBytes returns the average serialized object size to use for
+// the mutated resource, or 0 when sizeFn is not set (the caller then falls
+// back to the legacy watch-count-only formula). A sizeFn that hasn't
+// observed the resource yet reports 0, in which case defaultAverageObjectBytes
+// is assumed rather than treating the fan-out payload as empty.
+func (e *mutatingWidthEstimator) averageObjectBytes(requestInfo *apirequest.RequestInfo) int64 {
+	if e.sizeFn == nil {
+		return 0
+	}
+	if avgObjectBytes := e.sizeFn.Get(groupResource(requestInfo)); avgObjectBytes > 0 {
+		return avgObjectBytes
+	}
+	return defaultAverageObjectBytes
+}
+
+// objectSizeGetterFunc represents a function that returns the rolling
+// average serialized size, in bytes, of objects for a given resource, as
+// maintained by the storage layer. It returns 0 when no observations are
+// available yet for the resource.
+type objectSizeGetterFunc func(gr schema.GroupResource) int64
+
+func (f objectSizeGetterFunc) Get(gr schema.GroupResource) int64 {
+	return f(gr)
 }
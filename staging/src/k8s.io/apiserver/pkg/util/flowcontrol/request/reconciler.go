@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package request
+
+import (
+	"math"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+const (
+	// minWidthEstimationRatio and maxWidthEstimationRatio bound the
+	// correction multiplier a WidthReconciler can apply to a future
+	// estimate, so that a string of pathological observations can't make
+	// estimates run away.
+	minWidthEstimationRatio = 0.25
+	maxWidthEstimationRatio = 4.0
+
+	// widthEstimationEWMASmoothing is the weight given to the most recent
+	// observation when updating the per-key EWMA; the remaining weight is
+	// given to the previously accumulated average.
+	widthEstimationEWMASmoothing = 0.2
+
+	// widthEstimationMinSamples is the number of observations a key must
+	// accumulate before its ratio is trusted; until then Ratio reports the
+	// neutral 1.0 multiplier.
+	widthEstimationMinSamples = 10
+)
+
+// WidthReconciler is the sibling of WidthEstimatorFunc: where a
+// WidthEstimatorFunc predicts the Width of a request before it executes,
+// a WidthReconciler is told, after the request finishes, how its actual
+// Width (elapsed service time, objects processed for lists, watch events
+// delivered for mutations) compared to what was estimated. Implementations
+// use this feedback to correct future estimates for the same resource and
+// verb.
+type WidthReconciler interface {
+	// Observe reports that a request with the given RequestInfo, estimated
+	// to have estimated Width, actually turned out to have actual Width.
+	Observe(requestInfo *apirequest.RequestInfo, estimated, actual Width)
+
+	// Ratio returns the correction multiplier currently learned for the
+	// given GroupResource and verb, to be applied to future estimates for
+	// that key. Implementations should return the neutral 1.0 until they
+	// have gathered enough observations to trust it.
+	Ratio(gr schema.GroupResource, verb string) float64
+}
+
+type widthReconcilerKey struct {
+	groupResource schema.GroupResource
+	verb          string
+}
+
+type widthReconcilerEntry struct {
+	ratio   float64
+	samples uint64
+}
+
+// DefaultWidthReconciler is the default WidthReconciler. For every
+// GroupResource and verb it observes, it maintains an exponentially
+// weighted moving average of actual.Seats / estimated.Seats across
+// finished requests, bounded to [minWidthEstimationRatio,
+// maxWidthEstimationRatio], and exposes it as a correction multiplier
+// via Ratio that a WidthEstimatorFunc can apply to its own estimate.
+type DefaultWidthReconciler struct {
+	lock    sync.RWMutex
+	entries map[widthReconcilerKey]*widthReconcilerEntry
+}
+
+// NewDefaultWidthReconciler returns a DefaultWidthReconciler with no prior
+// observations.
+func NewDefaultWidthReconciler() *DefaultWidthReconciler {
+	return &DefaultWidthReconciler{
+		entries: map[widthReconcilerKey]*widthReconcilerEntry{},
+	}
+}
+
+// Observe implements WidthReconciler.
+func (r *DefaultWidthReconciler) Observe(requestInfo *apirequest.RequestInfo, estimated, actual Width) {
+	if estimated.Seats == 0 {
+		// nothing to correct a ratio against
+		return
+	}
+	key := widthReconcilerKey{groupResource: groupResource(requestInfo), verb: requestInfo.Verb}
+	observedRatio := float64(actual.Seats) / float64(estimated.Seats)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	entry, ok := r.entries[key]
+	if !ok {
+		entry = &widthReconcilerEntry{ratio: 1.0}
+		r.entries[key] = entry
+	}
+	if entry.samples == 0 {
+		entry.ratio = observedRatio
+	} else {
+		entry.ratio = (1-widthEstimationEWMASmoothing)*entry.ratio + widthEstimationEWMASmoothing*observedRatio
+	}
+	entry.samples++
+
+	widthEstimationRatio.WithLabelValues(key.groupResource.Group, key.groupResource.Resource, key.verb).Set(boundWidthEstimationRatio(entry.ratio))
+}
+
+// Ratio returns the correction multiplier learned for the given
+// GroupResource and verb. It returns 1.0 (no correction) until at least
+// widthEstimationMinSamples observations have been recorded for the key.
+func (r *DefaultWidthReconciler) Ratio(gr schema.GroupResource, verb string) float64 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	entry, ok := r.entries[widthReconcilerKey{groupResource: gr, verb: verb}]
+	if !ok || entry.samples < widthEstimationMinSamples {
+		return 1.0
+	}
+	return boundWidthEstimationRatio(entry.ratio)
+}
+
+func boundWidthEstimationRatio(ratio float64) float64 {
+	return math.Min(math.Max(ratio, minWidthEstimationRatio), maxWidthEstimationRatio)
+}
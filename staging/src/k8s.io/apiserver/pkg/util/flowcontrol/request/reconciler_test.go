@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package request
+
+import (
+	"math"
+	"testing"
+
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestDefaultWidthReconcilerConvergence(t *testing.T) {
+	reconciler := NewDefaultWidthReconciler()
+	requestInfo := &apirequest.RequestInfo{
+		Verb:     "create",
+		APIGroup: "foo.bar",
+		Resource: "resource",
+	}
+	gr := groupResource(requestInfo)
+
+	// actual width is consistently double the estimate, so the ratio
+	// should converge towards 2.0.
+	for i := 0; i < 200; i++ {
+		reconciler.Observe(requestInfo, Width{Seats: 2}, Width{Seats: 4})
+	}
+
+	got := reconciler.Ratio(gr, requestInfo.Verb)
+	if math.Abs(got-2.0) > 0.01 {
+		t.Errorf("expected ratio to converge to 2.0, got %v", got)
+	}
+}
+
+func TestDefaultWidthReconcilerBounded(t *testing.T) {
+	reconciler := NewDefaultWidthReconciler()
+	requestInfo := &apirequest.RequestInfo{
+		Verb:     "create",
+		APIGroup: "foo.bar",
+		Resource: "resource",
+	}
+	gr := groupResource(requestInfo)
+
+	// actual width is consistently 100x the estimate; the learned ratio
+	// must still be clamped to maxWidthEstimationRatio.
+	for i := 0; i < 200; i++ {
+		reconciler.Observe(requestInfo, Width{Seats: 1}, Width{Seats: 100})
+	}
+
+	got := reconciler.Ratio(gr, requestInfo.Verb)
+	if got != maxWidthEstimationRatio {
+		t.Errorf("expected ratio to be bounded at %v, got %v", maxWidthEstimationRatio, got)
+	}
+}
+
+func TestDefaultWidthReconcilerMinSamples(t *testing.T) {
+	reconciler := NewDefaultWidthReconciler()
+	requestInfo := &apirequest.RequestInfo{
+		Verb:     "update",
+		APIGroup: "foo.bar",
+		Resource: "resource",
+	}
+	gr := groupResource(requestInfo)
+
+	for i := 0; i < widthEstimationMinSamples-1; i++ {
+		reconciler.Observe(requestInfo, Width{Seats: 1}, Width{Seats: 4})
+		if got := reconciler.Ratio(gr, requestInfo.Verb); got != 1.0 {
+			t.Errorf("expected ratio to stay at neutral 1.0 before %d samples are collected, got %v at sample %d", widthEstimationMinSamples, got, i+1)
+		}
+	}
+
+	// the Nth sample crosses the threshold and the learned ratio should
+	// now be reflected.
+	reconciler.Observe(requestInfo, Width{Seats: 1}, Width{Seats: 4})
+	if got := reconciler.Ratio(gr, requestInfo.Verb); got == 1.0 {
+		t.Errorf("expected ratio to no longer be neutral once %d samples are collected, got %v", widthEstimationMinSamples, got)
+	}
+}
+
+func TestDefaultWidthReconcilerIgnoresZeroEstimate(t *testing.T) {
+	reconciler := NewDefaultWidthReconciler()
+	requestInfo := &apirequest.RequestInfo{
+		Verb:     "delete",
+		APIGroup: "foo.bar",
+		Resource: "resource",
+	}
+	gr := groupResource(requestInfo)
+
+	for i := 0; i < widthEstimationMinSamples*2; i++ {
+		reconciler.Observe(requestInfo, Width{Seats: 0}, Width{Seats: 4})
+	}
+
+	if got := reconciler.Ratio(gr, requestInfo.Verb); got != 1.0 {
+		t.Errorf("expected a zero-seat estimate to never be recorded, got ratio %v", got)
+	}
+}
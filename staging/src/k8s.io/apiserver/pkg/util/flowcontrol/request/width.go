@@ -18,8 +18,11 @@ package request
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"time"
 
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	apirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/klog/v2"
 )
@@ -33,8 +36,20 @@ const (
 )
 
 type Width struct {
-	// Seats represents the number of seats associated with this request
+	// Seats represents the number of seats associated with this request.
+	// Seats is always bounded to the range [minimumSeats, maximumSeats].
 	Seats uint
+
+	// AdditionalLatency represents the additional duration the request is
+	// expected to take on top of the "service time" already reflected by
+	// Seats. It lets the Priority & Fairness dispatcher hold the seats
+	// occupied by the request for serviceTime + AdditionalLatency instead
+	// of inflating Seats to approximate a long-tailed cost.
+	//
+	// Unlike Seats, AdditionalLatency is not bounded, but it is expected
+	// to grow monotonically with the amount of work a request is
+	// estimated to incur.
+	AdditionalLatency time.Duration
 }
 
 // objectCountGetterFunc represents a function that gets the total
@@ -45,11 +60,82 @@ func (f objectCountGetterFunc) Get(key string) int64 {
 	return f(key)
 }
 
+// watchCountGetterFunc represents a function that gets the total
+// number of watchers currently registered for the resource being
+// mutated by the given request.
+type watchCountGetterFunc func(*apirequest.RequestInfo) int
+
+func (f watchCountGetterFunc) Get(requestInfo *apirequest.RequestInfo) int {
+	return f(requestInfo)
+}
+
+// PerVerbWidthEstimator allows a downstream consumer (e.g. the
+// aggregator, or an extension apiserver) to register its own
+// WidthEstimatorFunc for a given request verb, without forking this
+// package.
+type PerVerbWidthEstimator struct {
+	// Verb is the request verb (e.g. "create", "deletecollection")
+	// this estimator should be used for.
+	Verb string
+	// Estimator is consulted instead of the built-in estimator for
+	// the given Verb.
+	Estimator WidthEstimatorFunc
+}
+
+// WidthEstimatorConfig groups the inputs NewWidthEstimator needs to build
+// a WidthEstimatorFunc. CountFn and WatchCountFn are required; every other
+// field is optional and, left unset, preserves the legacy behavior for the
+// knob it controls.
+type WidthEstimatorConfig struct {
+	// CountFn gets the total number of objects for a given resource; it
+	// feeds the list estimator's default (unfiltered) object count.
+	CountFn objectCountGetterFunc
+
+	// WatchCountFn gets the total number of watchers currently registered
+	// for the resource being mutated by a given request; it feeds the
+	// mutating estimator.
+	WatchCountFn watchCountGetterFunc
+
+	// ObjectSizeFn, if set, lets the mutating estimator scale seats with
+	// the average serialized object size for the mutated resource instead
+	// of assuming a fixed size.
+	ObjectSizeFn objectSizeGetterFunc
+
+	// IndexCostEstimators, if set, lets the list estimator consult a
+	// selector-aware object count for the given GroupResource instead of
+	// its unfiltered count.
+	IndexCostEstimators map[schema.GroupResource]IndexCostEstimator
+
+	// Reconciler, if set, is consulted after every sub-estimator runs and
+	// its learned Ratio for the request's GroupResource and verb is
+	// applied as a multiplier to the resulting Seats and
+	// AdditionalLatency, correcting future estimates based on previously
+	// Observe'd request outcomes.
+	Reconciler WidthReconciler
+
+	// AdditionalEstimators, if set, are registered on top of (and can
+	// override) the built-in per-verb estimators, so downstream consumers
+	// (e.g. the aggregator, or an extension apiserver) can plug in their
+	// own WidthEstimatorFunc without forking this package.
+	AdditionalEstimators []PerVerbWidthEstimator
+}
+
 // NewWidthEstimator calculates the width of the given request, if no WidthEstimatorFunc
 // matches the given request then the default width with '1' Seats is returned.
-func NewWidthEstimator(countFn objectCountGetterFunc) WidthEstimatorFunc {
+func NewWidthEstimator(config WidthEstimatorConfig) WidthEstimatorFunc {
+	mutatingEstimator := newMutatingWidthEstimator(config.WatchCountFn, config.ObjectSizeFn)
 	estimator := &widthEstimator{
-		listWidthEstimator: newListWidthEstimator(countFn),
+		listWidthEstimator: newListWidthEstimator(config.CountFn, config.IndexCostEstimators),
+		estimatorsByVerb: map[string]WidthEstimatorFunc{
+			"create": mutatingEstimator,
+			"update": mutatingEstimator,
+			"patch":  mutatingEstimator,
+			"delete": mutatingEstimator,
+		},
+		reconciler: config.Reconciler,
+	}
+	for _, additional := range config.AdditionalEstimators {
+		estimator.estimatorsByVerb[additional.Verb] = additional.Estimator
 	}
 	return estimator.estimate
 }
@@ -66,6 +152,17 @@ func (e WidthEstimatorFunc) EstimateWidth(r *http.Request) Width {
 type widthEstimator struct {
 	// listWidthEstimator calculates the width of list request(s)
 	listWidthEstimator WidthEstimatorFunc
+
+	// estimatorsByVerb dispatches verbs (create, update, patch, delete, and
+	// any additional verbs registered via NewWidthEstimator) to the
+	// WidthEstimatorFunc responsible for them. An entry registered for
+	// "list" takes precedence over listWidthEstimator.
+	estimatorsByVerb map[string]WidthEstimatorFunc
+
+	// reconciler, if set, corrects the width returned by the sub-estimators
+	// above using the ratio it has learned from prior Observe calls for the
+	// request's GroupResource and verb.
+	reconciler WidthReconciler
 }
 
 func (e *widthEstimator) estimate(r *http.Request) Width {
@@ -76,10 +173,41 @@ func (e *widthEstimator) estimate(r *http.Request) Width {
 		return Width{Seats: maximumSeats}
 	}
 
-	switch requestInfo.Verb {
-	case "list":
-		return e.listWidthEstimator.EstimateWidth(r)
+	var width Width
+	if estimator, ok := e.estimatorsByVerb[requestInfo.Verb]; ok {
+		width = estimator.EstimateWidth(r)
+	} else if requestInfo.Verb == "list" {
+		width = e.listWidthEstimator.EstimateWidth(r)
+	} else {
+		return Width{Seats: minimumSeats}
 	}
 
-	return Width{Seats: minimumSeats}
+	return e.reconcile(requestInfo, width)
+}
+
+// reconcile applies the correction multiplier learned by e.reconciler, if
+// any, to width. Seats stays bounded to [minimumSeats, maximumSeats];
+// AdditionalLatency is scaled by the same ratio and is otherwise unbounded.
+func (e *widthEstimator) reconcile(requestInfo *apirequest.RequestInfo, width Width) Width {
+	if e.reconciler == nil {
+		return width
+	}
+
+	ratio := e.reconciler.Ratio(groupResource(requestInfo), requestInfo.Verb)
+	if ratio == 1.0 {
+		return width
+	}
+
+	seats := uint(math.Round(float64(width.Seats) * ratio))
+	if seats < minimumSeats {
+		seats = minimumSeats
+	}
+	if seats > maximumSeats {
+		seats = maximumSeats
+	}
+
+	return Width{
+		Seats:             seats,
+		AdditionalLatency: time.Duration(float64(width.AdditionalLatency) * ratio),
+	}
 }
@@ -19,19 +19,35 @@ package request
 import (
 	"net/http"
 	"testing"
+	"time"
 
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	apirequest "k8s.io/apiserver/pkg/endpoints/request"
 )
 
+// fakeIndexCostEstimator always reports count as the indexed match count.
+type fakeIndexCostEstimator struct {
+	count int64
+}
+
+func (f fakeIndexCostEstimator) EstimateMatchingObjects(_ fields.Selector, _ labels.Selector) (int64, bool) {
+	return f.count, true
+}
+
 func TestWidthEstimator(t *testing.T) {
 	tests := []struct {
-		name          string
-		verb          string
-		requestURI    string
-		requestInfo   *apirequest.RequestInfo
-		counts        map[string]int64
-		watchCount    int
-		seatsExpected uint
+		name                      string
+		verb                      string
+		requestURI                string
+		requestInfo               *apirequest.RequestInfo
+		counts                    map[string]int64
+		watchCount                int
+		objectSizes               map[schema.GroupResource]int64
+		indexCostEstimators       map[schema.GroupResource]IndexCostEstimator
+		seatsExpected             uint
+		additionalLatencyExpected time.Duration
 	}{
 		{
 			name:          "request has no RequestInfo",
@@ -170,7 +186,8 @@ func TestWidthEstimator(t *testing.T) {
 			counts: map[string]int64{
 				"resource.foo.bar": 1999,
 			},
-			seatsExpected: 10,
+			seatsExpected:             10,
+			additionalLatencyExpected: 99900 * time.Microsecond,
 		},
 		{
 			name:       "request verb is list, list from cache, count not known",
@@ -215,8 +232,9 @@ func TestWidthEstimator(t *testing.T) {
 				APIGroup: "foo.bar",
 				Resource: "resource",
 			},
-			watchCount:    1999,
-			seatsExpected: 10,
+			watchCount:                1999,
+			seatsExpected:             10,
+			additionalLatencyExpected: 199800 * time.Microsecond,
 		},
 		{
 			name:       "request verb is update, no watches",
@@ -287,6 +305,84 @@ func TestWidthEstimator(t *testing.T) {
 			watchCount:    299,
 			seatsExpected: 3,
 		},
+		{
+			name:       "request verb is list, list from cache, indexed resource honors selector count",
+			verb:       "GET",
+			requestURI: "http://server/apis/v1/pods/1?resourceVersion=0&fieldSelector=spec.nodeName%3Dnode1",
+			requestInfo: &apirequest.RequestInfo{
+				Verb:     "list",
+				APIGroup: "",
+				Resource: "pods",
+			},
+			counts: map[string]int64{
+				"pods": 5000,
+			},
+			indexCostEstimators: map[schema.GroupResource]IndexCostEstimator{
+				{Resource: "pods"}: fakeIndexCostEstimator{count: 42},
+			},
+			seatsExpected: 1,
+		},
+		{
+			name:       "request verb is list, list from cache, non-indexed resource falls back to unfiltered count",
+			verb:       "GET",
+			requestURI: "http://server/apis/v1/foos/1?resourceVersion=0&fieldSelector=spec.nodeName%3Dnode1",
+			requestInfo: &apirequest.RequestInfo{
+				Verb:     "list",
+				APIGroup: "foo.bar",
+				Resource: "resource",
+			},
+			counts: map[string]int64{
+				"resource.foo.bar": 799,
+			},
+			indexCostEstimators: map[schema.GroupResource]IndexCostEstimator{
+				{Resource: "pods"}: fakeIndexCostEstimator{count: 42},
+			},
+			seatsExpected: 8,
+		},
+		{
+			name:       "request verb is list, list from cache, indexed resource count clamped by limit",
+			verb:       "GET",
+			requestURI: "http://server/apis/v1/pods/1?resourceVersion=0&limit=10&fieldSelector=spec.nodeName%3Dnode1",
+			requestInfo: &apirequest.RequestInfo{
+				Verb:     "list",
+				APIGroup: "",
+				Resource: "pods",
+			},
+			indexCostEstimators: map[schema.GroupResource]IndexCostEstimator{
+				{Resource: "pods"}: fakeIndexCostEstimator{count: 1999},
+			},
+			seatsExpected: 1,
+		},
+		{
+			name:       "request verb is create, watches registered, small object size",
+			verb:       "POST",
+			requestURI: "http://server/apis/v1/foos",
+			requestInfo: &apirequest.RequestInfo{
+				Verb:     "create",
+				APIGroup: "foo.bar",
+				Resource: "resource",
+			},
+			watchCount: 299,
+			objectSizes: map[schema.GroupResource]int64{
+				{Group: "foo.bar", Resource: "resource"}: 100,
+			},
+			seatsExpected: 1,
+		},
+		{
+			name:       "request verb is update, watches registered, large object size",
+			verb:       "PUT",
+			requestURI: "http://server/apis/v1/foos/myfoo",
+			requestInfo: &apirequest.RequestInfo{
+				Verb:     "update",
+				APIGroup: "foo.bar",
+				Resource: "resource",
+			},
+			watchCount: 299,
+			objectSizes: map[schema.GroupResource]int64{
+				{Group: "foo.bar", Resource: "resource"}: 1024 * 1024,
+			},
+			seatsExpected: 10,
+		},
 	}
 
 	for _, test := range tests {
@@ -301,7 +397,19 @@ func TestWidthEstimator(t *testing.T) {
 			watchCountsFn := func(_ *apirequest.RequestInfo) int {
 				return test.watchCount
 			}
-			estimator := NewWidthEstimator(countsFn, watchCountsFn)
+			var objectSizeFn objectSizeGetterFunc
+			if len(test.objectSizes) > 0 {
+				objectSizes := test.objectSizes
+				objectSizeFn = func(gr schema.GroupResource) int64 {
+					return objectSizes[gr]
+				}
+			}
+			estimator := NewWidthEstimator(WidthEstimatorConfig{
+				CountFn:             countsFn,
+				WatchCountFn:        watchCountsFn,
+				ObjectSizeFn:        objectSizeFn,
+				IndexCostEstimators: test.indexCostEstimators,
+			})
 
 			req, err := http.NewRequest(test.verb, test.requestURI, nil)
 			if err != nil {
@@ -316,6 +424,56 @@ func TestWidthEstimator(t *testing.T) {
 			if test.seatsExpected != widthGot.Seats {
 				t.Errorf("Expected request width to match: %d seats, but got: %d seats", test.seatsExpected, widthGot.Seats)
 			}
+			if test.additionalLatencyExpected != widthGot.AdditionalLatency {
+				t.Errorf("Expected request width to match: %s additional latency, but got: %s", test.additionalLatencyExpected, widthGot.AdditionalLatency)
+			}
 		})
 	}
 }
+
+// TestWidthEstimatorAppliesReconciler verifies that once a WidthReconciler
+// has observed enough mismatches between estimated and actual Width for a
+// GroupResource and verb, NewWidthEstimator folds its learned ratio into
+// later EstimateWidth calls for that same key.
+func TestWidthEstimatorAppliesReconciler(t *testing.T) {
+	countsFn := func(string) int64 { return 0 }
+	watchCountsFn := func(*apirequest.RequestInfo) int { return 299 }
+	reconciler := NewDefaultWidthReconciler()
+	estimator := NewWidthEstimator(WidthEstimatorConfig{
+		CountFn:      countsFn,
+		WatchCountFn: watchCountsFn,
+		Reconciler:   reconciler,
+	})
+
+	requestInfo := &apirequest.RequestInfo{
+		Verb:     "create",
+		APIGroup: "foo.bar",
+		Resource: "resource",
+	}
+	newRequest := func() *http.Request {
+		req, err := http.NewRequest("POST", "http://server/apis/v1/foos", nil)
+		if err != nil {
+			t.Fatalf("Failed to create new HTTP request - %v", err)
+		}
+		return req.WithContext(apirequest.WithRequestInfo(req.Context(), requestInfo))
+	}
+
+	before := estimator.EstimateWidth(newRequest())
+	if before.Seats != 3 {
+		t.Fatalf("expected the un-corrected estimate to be 3 seats, got %d", before.Seats)
+	}
+
+	// report that every one of these requests actually needed twice as
+	// many seats as estimated, enough times to cross widthEstimationMinSamples.
+	for i := 0; i < widthEstimationMinSamples; i++ {
+		reconciler.Observe(requestInfo, Width{Seats: before.Seats}, Width{Seats: before.Seats * 2})
+	}
+
+	after := estimator.EstimateWidth(newRequest())
+	if after.Seats <= before.Seats {
+		t.Errorf("expected a prior Observe to raise the next estimate above %d seats, got %d", before.Seats, after.Seats)
+	}
+	if after.Seats != 6 {
+		t.Errorf("expected the corrected estimate to be 6 seats (3 seats x 2.0 ratio), got %d", after.Seats)
+	}
+}